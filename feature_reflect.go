@@ -5,8 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
-	"time"
 	"unsafe"
+
+	"github.com/mutemaniac/go/reflect2"
 )
 
 // ValDecoder is an internal type registered to cache as needed.
@@ -33,16 +34,12 @@ type ValEncoder interface {
 }
 
 func WriteToStream(val interface{}, stream *Stream, encoder ValEncoder) {
-	e := (*emptyInterface)(unsafe.Pointer(&val))
-	if e.word == nil {
+	ptr, ok := reflect2.IndirectEFace(val)
+	if !ok {
 		stream.WriteNil()
 		return
 	}
-	if reflect.TypeOf(val).Kind() == reflect.Ptr {
-		encoder.Encode(unsafe.Pointer(&e.word), stream)
-	} else {
-		encoder.Encode(e.word, stream)
-	}
+	encoder.Encode(ptr, stream)
 }
 
 type DecoderFunc func(ptr unsafe.Pointer, iter *Iterator)
@@ -67,7 +64,7 @@ func init() {
 }
 
 type optionalDecoder struct {
-	valueType    reflect.Type
+	valueType    reflect2.Type
 	valueDecoder ValDecoder
 }
 
@@ -77,9 +74,9 @@ func (decoder *optionalDecoder) Decode(ptr unsafe.Pointer, iter *Iterator) {
 	} else {
 		if *((*unsafe.Pointer)(ptr)) == nil {
 			// pointer to null, we have to allocate memory to hold the value
-			value := reflect.New(decoder.valueType)
-			decoder.valueDecoder.Decode(unsafe.Pointer(value.Pointer()), iter)
-			*((*uintptr)(ptr)) = value.Pointer()
+			newPtr := decoder.valueType.UnsafeNew()
+			decoder.valueDecoder.Decode(newPtr, iter)
+			*((*unsafe.Pointer)(ptr)) = newPtr
 		} else {
 			// reuse existing instance
 			decoder.valueDecoder.Decode(*((*unsafe.Pointer)(ptr)), iter)
@@ -111,9 +108,17 @@ func (encoder *optionalEncoder) IsEmpty(ptr unsafe.Pointer) bool {
 	}
 }
 
+// placeholderEncoder is installed into the cache while its real encoder is
+// still being built, so that self-referential types (a struct embedding a
+// pointer to itself, a linked-list node, ...) can close over a reference to
+// their own encoder mid-construction. ready is closed exactly once, by
+// whichever call to encoderOfType built this cacheKey, the moment the real
+// encoder replaces the placeholder in the cache - so a concurrent caller on
+// another goroutine blocks on ready instead of polling for it.
 type placeholderEncoder struct {
 	cfg      *frozenConfig
 	cacheKey reflect.Type
+	ready    chan struct{}
 }
 
 func (encoder *placeholderEncoder) Encode(ptr unsafe.Pointer, stream *Stream) {
@@ -129,55 +134,30 @@ func (encoder *placeholderEncoder) IsEmpty(ptr unsafe.Pointer) bool {
 }
 
 func (encoder *placeholderEncoder) getRealEncoder() ValEncoder {
-	for i := 0; i < 30; i++ {
-		realDecoder := encoder.cfg.getEncoderFromCache(encoder.cacheKey)
-		_, isPlaceholder := realDecoder.(*placeholderEncoder)
-		if isPlaceholder {
-			time.Sleep(time.Second)
-		} else {
-			return realDecoder
-		}
+	<-encoder.ready
+	realEncoder := encoder.cfg.getEncoderFromCache(encoder.cacheKey)
+	if _, isPlaceholder := realEncoder.(*placeholderEncoder); isPlaceholder {
+		panic(fmt.Sprintf("real encoder not found for cache key: %v", encoder.cacheKey))
 	}
-	panic(fmt.Sprintf("real encoder not found for cache key: %v", encoder.cacheKey))
+	return realEncoder
 }
 
+// placeholderDecoder is the decoder-side counterpart of placeholderEncoder;
+// see its doc comment for why ready exists and how self-referential types
+// are handled.
 type placeholderDecoder struct {
 	cfg      *frozenConfig
 	cacheKey reflect.Type
+	ready    chan struct{}
 }
 
 func (decoder *placeholderDecoder) Decode(ptr unsafe.Pointer, iter *Iterator) {
-	for i := 0; i < 30; i++ {
-		realDecoder := decoder.cfg.getDecoderFromCache(decoder.cacheKey)
-		_, isPlaceholder := realDecoder.(*placeholderDecoder)
-		if isPlaceholder {
-			time.Sleep(time.Second)
-		} else {
-			realDecoder.Decode(ptr, iter)
-			return
-		}
+	<-decoder.ready
+	realDecoder := decoder.cfg.getDecoderFromCache(decoder.cacheKey)
+	if _, isPlaceholder := realDecoder.(*placeholderDecoder); isPlaceholder {
+		panic(fmt.Sprintf("real decoder not found for cache key: %v", decoder.cacheKey))
 	}
-	panic(fmt.Sprintf("real decoder not found for cache key: %v", decoder.cacheKey))
-}
-
-// emptyInterface is the header for an interface{} value.
-type emptyInterface struct {
-	typ  unsafe.Pointer
-	word unsafe.Pointer
-}
-
-// emptyInterface is the header for an interface with method (not interface{})
-type nonEmptyInterface struct {
-	// see ../runtime/iface.go:/Itab
-	itab *struct {
-		ityp   unsafe.Pointer // static interface type
-		typ    unsafe.Pointer // dynamic concrete type
-		link   unsafe.Pointer
-		bad    int32
-		unused int32
-		fun    [100000]unsafe.Pointer // method table
-	}
-	word unsafe.Pointer
+	realDecoder.Decode(ptr, iter)
 }
 
 // Read converts an Iterator instance into go interface, same as json.Unmarshal
@@ -189,8 +169,8 @@ func (iter *Iterator) ReadVal(obj interface{}) {
 		iter.Error = err
 		return
 	}
-	e := (*emptyInterface)(unsafe.Pointer(&obj))
-	decoder.Decode(e.word, iter)
+	_, word := reflect2.UnpackEFace(obj)
+	decoder.Decode(word, iter)
 }
 
 func (stream *Stream) WriteVal(val interface{}) {
@@ -235,8 +215,12 @@ func decoderOfType(cfg *frozenConfig, typ reflect.Type) (ValDecoder, error) {
 		cfg.addDecoderToCache(cacheKey, decoder)
 		return decoder, nil
 	}
-	decoder = &placeholderDecoder{cfg: cfg, cacheKey: cacheKey}
+	ready := make(chan struct{})
+	decoder = &placeholderDecoder{cfg: cfg, cacheKey: cacheKey, ready: ready}
 	cfg.addDecoderToCache(cacheKey, decoder)
+	// ready must close even if building the real decoder panics, or every
+	// goroutine parked on it in placeholderDecoder.Decode hangs forever.
+	defer close(ready)
 	decoder, err := createDecoderOfType(cfg, typ)
 	for _, extension := range extensions {
 		decoder = extension.DecorateDecoder(typ, decoder)
@@ -259,16 +243,20 @@ func createDecoderOfType(cfg *frozenConfig, typ reflect.Type) (ValDecoder, error
 		return &jsonNumberCodec{}, nil
 	}
 	if typ.ConvertibleTo(unmarshalerType) {
-		templateInterface := reflect.New(typ).Elem().Interface()
-		var decoder ValDecoder = &unmarshalerDecoder{extractInterface(templateInterface)}
+		var decoder ValDecoder = &unmarshalerDecoder{reflect2.TypeOf(typ)}
 		if typ.Kind() != reflect.Struct {
-			decoder = &optionalDecoder{typ, decoder}
+			decoder = &optionalDecoder{reflect2.TypeOf(typ), decoder}
 		}
 		return decoder, nil
 	}
 	if typ.ConvertibleTo(anyType) {
 		return &anyCodec{}, nil
 	}
+	if typ.Kind() == reflect.Interface {
+		if union, found := typeUnionFor(cfg, typ); found {
+			return &unionDecoder{union}, nil
+		}
+	}
 	switch typ.Kind() {
 	case reflect.String:
 		return &stringCodec{}, nil
@@ -299,7 +287,7 @@ func createDecoderOfType(cfg *frozenConfig, typ reflect.Type) (ValDecoder, error
 	case reflect.Bool:
 		return &boolCodec{}, nil
 	case reflect.Interface:
-		if typ.NumMethod() == 0 {
+		if reflect2.TypeOf(typ).(reflect2.InterfaceType).IsEmptyInterface() {
 			return &emptyInterfaceCodec{}, nil
 		} else {
 			return &nonEmptyInterfaceCodec{}, nil
@@ -330,8 +318,13 @@ func encoderOfType(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error) {
 		cfg.addEncoderToCache(cacheKey, encoder)
 		return encoder, nil
 	}
-	encoder = &placeholderEncoder{cfg: cfg, cacheKey: cacheKey}
+	ready := make(chan struct{})
+	encoder = &placeholderEncoder{cfg: cfg, cacheKey: cacheKey, ready: ready}
 	cfg.addEncoderToCache(cacheKey, encoder)
+	// ready must close even if building the real encoder panics, or every
+	// goroutine parked on it in placeholderEncoder.getRealEncoder hangs
+	// forever.
+	defer close(ready)
 	encoder, err := createEncoderOfType(cfg, typ)
 	for _, extension := range extensions {
 		encoder = extension.DecorateEncoder(typ, encoder)
@@ -354,8 +347,7 @@ func createEncoderOfType(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error
 		return &jsonNumberCodec{}, nil
 	}
 	if typ.ConvertibleTo(marshalerType) {
-		templateInterface := reflect.New(typ).Elem().Interface()
-		var encoder ValEncoder = &marshalerEncoder{extractInterface(templateInterface)}
+		var encoder ValEncoder = &marshalerEncoder{reflect2.TypeOf(typ)}
 		if typ.Kind() != reflect.Struct {
 			encoder = &optionalEncoder{encoder}
 		}
@@ -364,6 +356,11 @@ func createEncoderOfType(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error
 	if typ.ConvertibleTo(anyType) {
 		return &anyCodec{}, nil
 	}
+	if typ.Kind() == reflect.Interface {
+		if union, found := typeUnionFor(cfg, typ); found {
+			return &unionEncoder{union}, nil
+		}
+	}
 	kind := typ.Kind()
 	switch kind {
 	case reflect.String:
@@ -395,7 +392,7 @@ func createEncoderOfType(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error
 	case reflect.Bool:
 		return &boolCodec{}, nil
 	case reflect.Interface:
-		if typ.NumMethod() == 0 {
+		if reflect2.TypeOf(typ).(reflect2.InterfaceType).IsEmptyInterface() {
 			return &emptyInterfaceCodec{}, nil
 		} else {
 			return &nonEmptyInterfaceCodec{}, nil
@@ -421,7 +418,7 @@ func decoderOfOptional(cfg *frozenConfig, typ reflect.Type) (ValDecoder, error)
 	if err != nil {
 		return nil, err
 	}
-	return &optionalDecoder{elemType, decoder}, nil
+	return &optionalDecoder{reflect2.TypeOf(elemType), decoder}, nil
 }
 
 func encoderOfOptional(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error) {
@@ -442,12 +439,7 @@ func decoderOfMap(cfg *frozenConfig, typ reflect.Type) (ValDecoder, error) {
 	if err != nil {
 		return nil, err
 	}
-	mapInterface := reflect.New(typ).Interface()
-	return &mapDecoder{typ, typ.Key(), typ.Elem(), decoder, extractInterface(mapInterface)}, nil
-}
-
-func extractInterface(val interface{}) emptyInterface {
-	return *((*emptyInterface)(unsafe.Pointer(&val)))
+	return &mapDecoder{reflect2.TypeOf(typ).(reflect2.MapType), decoder}, nil
 }
 
 func encoderOfMap(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error) {
@@ -456,10 +448,10 @@ func encoderOfMap(cfg *frozenConfig, typ reflect.Type) (ValEncoder, error) {
 	if err != nil {
 		return nil, err
 	}
-	mapInterface := reflect.New(typ).Elem().Interface()
+	mapType := reflect2.TypeOf(typ).(reflect2.MapType)
 	if cfg.sortMapKeys {
-		return &sortKeysMapEncoder{typ, elemType, encoder, *((*emptyInterface)(unsafe.Pointer(&mapInterface)))}, nil
+		return &sortKeysMapEncoder{mapType, encoder}, nil
 	} else {
-		return &mapEncoder{typ, elemType, encoder, *((*emptyInterface)(unsafe.Pointer(&mapInterface)))}, nil
+		return &mapEncoder{mapType, encoder}, nil
 	}
 }
@@ -0,0 +1,71 @@
+package jsoniter
+
+// As with feature_union_test.go, this exercises the public Marshal/
+// Unmarshal entry points (defined elsewhere in the full module, not in
+// this chunk) rather than poking placeholderDecoder/placeholderEncoder
+// directly, matching how the rest of the suite tests codec behavior.
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type treeNode struct {
+	Value    int
+	Children []*treeNode
+}
+
+// TestRecursiveTypeDecode pins down that a self-referential type still
+// gets a usable decoder for its own subtree while that decoder is still
+// under construction - the placeholder must be returned immediately to
+// the same goroutine building it, not block it on its own ready channel.
+func TestRecursiveTypeDecode(t *testing.T) {
+	data := []byte(`{"Value":1,"Children":[{"Value":2,"Children":[]},{"Value":3,"Children":[{"Value":4,"Children":[]}]}]}`)
+	var root treeNode
+	if err := Unmarshal(data, &root); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(root.Children) != 2 || root.Children[1].Children[0].Value != 4 {
+		t.Fatalf("got %#v", root)
+	}
+}
+
+type concurrentProbeType struct {
+	A, B, C int
+}
+
+// TestConcurrentFirstUseDoesNotHang exercises the ready-channel fix:
+// many goroutines racing to Marshal a type for the first time must all
+// make progress - any goroutine that finds another's placeholder in the
+// cache blocks on its ready channel and wakes as soon as it closes, with
+// no polling interval to wait out.
+func TestConcurrentFirstUseDoesNotHang(t *testing.T) {
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			v := concurrentProbeType{A: i, B: i * 2, C: i * 3}
+			if _, err := Marshal(v); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Marshal calls did not complete within 5s - a placeholder wait likely hung")
+	}
+	close(errs)
+	for err := range errs {
+		t.Errorf("Marshal: %v", err)
+	}
+}
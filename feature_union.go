@@ -0,0 +1,259 @@
+package jsoniter
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"unsafe"
+
+	"github.com/mutemaniac/go/reflect2"
+)
+
+// UnionOption configures a type union registered with RegisterTypeUnion.
+type UnionOption func(*typeUnion)
+
+// WrappedUnion lays a union value out as
+// {"<discriminator>":"<tag>","<valueKey>":{...}} instead of the default of
+// flattening the value's own fields into the same JSON object as the
+// discriminator.
+func WrappedUnion(valueKey string) UnionOption {
+	return func(u *typeUnion) {
+		u.wrapped = true
+		u.valueKey = valueKey
+	}
+}
+
+type typeUnion struct {
+	ifaceType     reflect.Type
+	discriminator string
+	tagToType     map[string]reflect.Type
+	typeToTag     map[reflect.Type]string
+	wrapped       bool
+	valueKey      string
+}
+
+// typeUnionsMu guards typeUnions, which holds every union registered with
+// RegisterTypeUnion, scoped per frozenConfig and then keyed by the
+// interface type it polymorphically decodes/encodes. Scoping by cfg
+// mirrors how extensions compose per Config instead of leaking across
+// every Config in the process.
+var (
+	typeUnionsMu sync.RWMutex
+	typeUnions   = map[*frozenConfig]map[reflect.Type]*typeUnion{}
+)
+
+// RegisterTypeUnion declares that, for cfg, iface (an interface type) is
+// decoded and encoded as a discriminated union: the discriminator field
+// of the JSON object selects, via mapping, which concrete Go type the
+// rest of the object is unmarshaled into. Decoding allocates that
+// concrete type, decodes into it with the same codec a direct ReadVal
+// would use, and stores it into the interface value; encoding does the
+// reverse, writing the discriminator alongside whatever concrete type
+// the interface holds.
+//
+// By default the concrete value's own fields are flattened into the same
+// JSON object as the discriminator. Pass WrappedUnion to nest them under
+// a separate key instead. The registration is scoped to cfg, so two
+// Configs can map the same interface to different unions; register
+// before cfg is used to read or write values of iface.
+func RegisterTypeUnion(cfg *frozenConfig, iface reflect.Type, discriminator string, mapping map[string]reflect.Type, opts ...UnionOption) {
+	if iface.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("RegisterTypeUnion: %v is not an interface type", iface))
+	}
+	u := &typeUnion{
+		ifaceType:     iface,
+		discriminator: discriminator,
+		tagToType:     make(map[string]reflect.Type, len(mapping)),
+		typeToTag:     make(map[reflect.Type]string, len(mapping)),
+	}
+	for tag, concreteType := range mapping {
+		u.tagToType[tag] = concreteType
+		u.typeToTag[concreteType] = tag
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	typeUnionsMu.Lock()
+	defer typeUnionsMu.Unlock()
+	byIface := typeUnions[cfg]
+	if byIface == nil {
+		byIface = map[reflect.Type]*typeUnion{}
+		typeUnions[cfg] = byIface
+	}
+	byIface[iface] = u
+}
+
+// typeUnionFor looks up the union, if any, that cfg registered for typ.
+func typeUnionFor(cfg *frozenConfig, typ reflect.Type) (*typeUnion, bool) {
+	typeUnionsMu.RLock()
+	defer typeUnionsMu.RUnlock()
+	byIface := typeUnions[cfg]
+	if byIface == nil {
+		return nil, false
+	}
+	u, found := byIface[typ]
+	return u, found
+}
+
+// peekDiscriminator makes a throwaway pass over raw with a borrowed
+// iterator just to find the discriminator field's string value, without
+// allocating the concrete type yet.
+func (u *typeUnion) peekDiscriminator(cfg *frozenConfig, raw []byte) (string, error) {
+	probe := cfg.BorrowIterator(raw)
+	defer cfg.ReturnIterator(probe)
+	tag := ""
+	for field := probe.ReadObject(); field != ""; field = probe.ReadObject() {
+		if field == u.discriminator {
+			tag = probe.ReadString()
+		} else {
+			probe.Skip()
+		}
+	}
+	if probe.Error != nil && probe.Error != io.EOF {
+		return "", probe.Error
+	}
+	if tag == "" {
+		return "", fmt.Errorf("missing %q discriminator", u.discriminator)
+	}
+	return tag, nil
+}
+
+// unwrapPayload pulls out the bytes under valueKey for a WrappedUnion.
+func (u *typeUnion) unwrapPayload(cfg *frozenConfig, raw []byte) ([]byte, error) {
+	probe := cfg.BorrowIterator(raw)
+	defer cfg.ReturnIterator(probe)
+	for field := probe.ReadObject(); field != ""; field = probe.ReadObject() {
+		if field == u.valueKey {
+			return probe.SkipAndReturnBytes(), nil
+		}
+		probe.Skip()
+	}
+	if probe.Error != nil && probe.Error != io.EOF {
+		return nil, probe.Error
+	}
+	return nil, fmt.Errorf("missing %q value for wrapped union %v", u.valueKey, u.ifaceType)
+}
+
+type unionDecoder struct {
+	union *typeUnion
+}
+
+func (decoder *unionDecoder) Decode(ptr unsafe.Pointer, iter *Iterator) {
+	if iter.ReadNil() {
+		// A full 2-word clear, not just the type word: ptr may already
+		// hold a populated union value, and leaving its data word stale
+		// would both pin that object in memory and leave the interface
+		// half-zeroed.
+		*(*interface{})(ptr) = nil
+		return
+	}
+	raw := iter.SkipAndReturnBytes()
+	u := decoder.union
+	tag, err := u.peekDiscriminator(iter.cfg, raw)
+	if err != nil {
+		iter.ReportError("decode "+u.ifaceType.String(), err.Error())
+		return
+	}
+	concreteType, found := u.tagToType[tag]
+	if !found {
+		iter.ReportError("decode "+u.ifaceType.String(), fmt.Sprintf("unregistered %s %q", u.discriminator, tag))
+		return
+	}
+	payload := raw
+	if u.wrapped {
+		payload, err = u.unwrapPayload(iter.cfg, raw)
+		if err != nil {
+			iter.ReportError("decode "+u.ifaceType.String(), err.Error())
+			return
+		}
+	}
+	valueDecoder, err := decoderOfType(iter.cfg, concreteType)
+	if err != nil {
+		iter.Error = err
+		return
+	}
+	valueType := reflect2.TypeOf(concreteType)
+	valuePtr := valueType.UnsafeNew()
+	valueIter := iter.cfg.BorrowIterator(payload)
+	defer iter.cfg.ReturnIterator(valueIter)
+	valueDecoder.Decode(valuePtr, valueIter)
+	if valueIter.Error != nil && valueIter.Error != io.EOF {
+		iter.Error = valueIter.Error
+		return
+	}
+	// Box the decoded value as concreteType itself, not *concreteType, so
+	// that a caller holding the union interface sees the same dynamic
+	// type it registered (v.(Dog), not v.(*Dog)) and re-encoding it finds
+	// it in typeToTag.
+	// Stored through reflect because ptr may point at an interface with
+	// methods, whose first word is an itab rather than a type pointer.
+	reflect.NewAt(u.ifaceType, ptr).Elem().Set(reflect.ValueOf(valueType.PackValue(valuePtr)))
+}
+
+type unionEncoder struct {
+	union *typeUnion
+}
+
+func (encoder *unionEncoder) IsEmpty(ptr unsafe.Pointer) bool {
+	return *(*unsafe.Pointer)(ptr) == nil
+}
+
+func (encoder *unionEncoder) EncodeInterface(val interface{}, stream *Stream) {
+	WriteToStream(val, stream, encoder)
+}
+
+func (encoder *unionEncoder) Encode(ptr unsafe.Pointer, stream *Stream) {
+	obj := reflect.NewAt(encoder.union.ifaceType, ptr).Elem().Interface()
+	if obj == nil {
+		stream.WriteNil()
+		return
+	}
+	u := encoder.union
+	concreteType := reflect.TypeOf(obj)
+	tag, found := u.typeToTag[concreteType]
+	if !found {
+		stream.Error = fmt.Errorf("%v is not registered in union %v", concreteType, u.ifaceType)
+		return
+	}
+	valueEncoder, err := encoderOfType(stream.cfg, concreteType)
+	if err != nil {
+		stream.Error = err
+		return
+	}
+
+	stream.WriteObjectStart()
+	stream.WriteObjectField(u.discriminator)
+	stream.WriteString(tag)
+
+	if u.wrapped {
+		stream.WriteMore()
+		stream.WriteObjectField(u.valueKey)
+		// WriteToStream (not a direct valueEncoder.Encode call) does the
+		// ptr-vs-value branch that pointer-kind union members need: it
+		// hands the encoder the address of a pointer slot rather than the
+		// pointee's address.
+		WriteToStream(obj, stream, valueEncoder)
+		stream.WriteObjectEnd()
+		return
+	}
+
+	valueStream := stream.cfg.BorrowStream(nil)
+	defer stream.cfg.ReturnStream(valueStream)
+	WriteToStream(obj, valueStream, valueEncoder)
+	if valueStream.Error != nil {
+		stream.Error = valueStream.Error
+		return
+	}
+	payload := valueStream.Buffer()
+	if len(payload) < 2 || payload[0] != '{' || payload[len(payload)-1] != '}' {
+		stream.Error = fmt.Errorf("union member %v must encode to a JSON object to flatten into %v", concreteType, u.ifaceType)
+		return
+	}
+	fields := payload[1 : len(payload)-1]
+	if len(fields) > 0 {
+		stream.WriteMore()
+		stream.WriteRaw(string(fields))
+	}
+	stream.WriteObjectEnd()
+}
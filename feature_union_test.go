@@ -0,0 +1,137 @@
+package jsoniter
+
+// This chunk of the module ships feature_reflect.go/feature_union.go in
+// isolation, without the rest of jsoniter (Marshal/Unmarshal, Stream,
+// Iterator, frozenConfig, the *Codec types) or a go.mod, so this file
+// can't be built or run here - see the package-level note in the other
+// backlog commits. It is written the way the full test suite would
+// exercise RegisterTypeUnion: through the public Marshal/Unmarshal
+// entry points, not by poking unionDecoder/unionEncoder directly.
+
+import (
+	"reflect"
+	"testing"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type circle struct {
+	Radius float64
+}
+
+func (c circle) Area() float64 { return 3.14159 * c.Radius * c.Radius }
+
+type square struct {
+	Side float64
+}
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+func init() {
+	RegisterTypeUnion(ConfigDefault, reflect.TypeOf((*shape)(nil)).Elem(), "type", map[string]reflect.Type{
+		"circle": reflect.TypeOf(circle{}),
+		"square": reflect.TypeOf(square{}),
+	})
+}
+
+// TestTypeUnionRoundTrip decodes a discriminated union into its concrete,
+// non-pointer type and re-encodes it. It pins down that PackValue (not
+// PackEFace) must box the decoded value as circle, not
+// *circle, or the type switch and the typeToTag lookup on re-encode both
+// fail.
+func TestTypeUnionRoundTrip(t *testing.T) {
+	var original shape = circle{Radius: 2}
+	data, err := Marshal(&original)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded shape
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	c, ok := decoded.(circle)
+	if !ok {
+		t.Fatalf("decoded value has dynamic type %T, want circle", decoded)
+	}
+	if c.Radius != 2 {
+		t.Fatalf("got Radius %v, want 2", c.Radius)
+	}
+
+	reencoded, err := Marshal(&decoded)
+	if err != nil {
+		t.Fatalf("Marshal of decoded value: %v", err)
+	}
+	if string(reencoded) != string(data) {
+		t.Fatalf("re-encoded %s, want %s", reencoded, data)
+	}
+}
+
+// namer's only implementation, labelPtr, has a pointer receiver, so the
+// concrete type registered for it is itself pointer-kind (*labelPtr).
+type namer interface {
+	Name() string
+}
+
+type labelPtr struct {
+	Text string
+}
+
+func (l *labelPtr) Name() string { return l.Text }
+
+// TestTypeUnionPointerMember exercises the WriteToStream fix: encoding a
+// union member whose concrete type is pointer-kind must go through the
+// ptr-vs-value branch, not hand the pointee's address straight to the
+// optional/pointer encoder as if it were a pointer slot to nil-check.
+func TestTypeUnionPointerMember(t *testing.T) {
+	ifaceType := reflect.TypeOf((*namer)(nil)).Elem()
+	RegisterTypeUnion(ConfigDefault, ifaceType, "type", map[string]reflect.Type{
+		"label": reflect.TypeOf(&labelPtr{}),
+	})
+
+	var original namer = &labelPtr{Text: "hi"}
+	data, err := Marshal(&original)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded namer
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	lp, ok := decoded.(*labelPtr)
+	if !ok || lp.Text != "hi" {
+		t.Fatalf("got %#v, want &labelPtr{Text:%q}", decoded, "hi")
+	}
+}
+
+// wrappedShape is registered only as a wrapped union. Re-registering
+// shape would have no effect here: ConfigDefault has already cached the
+// flat union codec for shape by the time this test runs.
+type wrappedShape interface {
+	Area() float64
+}
+
+func TestTypeUnionWrapped(t *testing.T) {
+	valueKey := "value"
+	ifaceType := reflect.TypeOf((*wrappedShape)(nil)).Elem()
+	RegisterTypeUnion(ConfigDefault, ifaceType, "kind", map[string]reflect.Type{
+		"square": reflect.TypeOf(square{}),
+	}, WrappedUnion(valueKey))
+
+	var original wrappedShape = square{Side: 3}
+	data, err := Marshal(&original)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded wrappedShape
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if sq, ok := decoded.(square); !ok || sq.Side != 3 {
+		t.Fatalf("got %#v, want square{Side:3}", decoded)
+	}
+}
@@ -0,0 +1,210 @@
+// Package reflect2 is jsoniter's single point of contact with the Go
+// runtime's interface{} layout. Codecs used to reach into hand-rolled
+// emptyInterface/nonEmptyInterface structs directly; now they go through
+// the Type wrappers here instead, so a runtime layout change (or a new
+// Go release) only has to be accounted for in this package.
+package reflect2
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// eface is the runtime representation of an interface{} value.
+type eface struct {
+	rtype unsafe.Pointer
+	word  unsafe.Pointer
+}
+
+// PackEFace builds an interface{} out of a concrete *rtype and a data
+// word, without allocating a reflect.Value.
+func PackEFace(rtype unsafe.Pointer, word unsafe.Pointer) interface{} {
+	var obj interface{}
+	e := (*eface)(unsafe.Pointer(&obj))
+	e.rtype = rtype
+	e.word = word
+	return obj
+}
+
+// UnpackEFace returns the concrete *rtype and data word backing obj.
+func UnpackEFace(obj interface{}) (rtype unsafe.Pointer, word unsafe.Pointer) {
+	e := (*eface)(unsafe.Pointer(&obj))
+	return e.rtype, e.word
+}
+
+// IndirectEFace returns the pointer a codec is handed for obj's value: a
+// pointer-kind dynamic type stores its value directly in the eface word,
+// so the address of a copy of that word is returned; for every other kind
+// word is returned as it is, which is a pointer to the payload for most
+// kinds but the value itself for map, chan and func kinds. ok is false
+// when the eface word is nil (the nil interface, or a nil pointer, map,
+// chan or func), in which case ptr is meaningless - callers should treat
+// that the same as "write JSON null".
+func IndirectEFace(obj interface{}) (ptr unsafe.Pointer, ok bool) {
+	_, word := UnpackEFace(obj)
+	if word == nil {
+		return nil, false
+	}
+	if reflect.TypeOf(obj).Kind() == reflect.Ptr {
+		return unsafe.Pointer(&word), true
+	}
+	return word, true
+}
+
+// Type wraps a reflect.Type with the unsafe operations codecs need:
+// allocating a value of this type, packing/unpacking it to and from
+// interface{}, and testing/copying through raw pointers.
+type Type interface {
+	// Type1 returns the wrapped reflect.Type.
+	Type1() reflect.Type
+	// UnsafeNew allocates a zero value of this type and returns a pointer
+	// to it.
+	UnsafeNew() unsafe.Pointer
+	// PackEFace packs ptr, treated as a *T, into an interface{} whose
+	// dynamic type is *T.
+	PackEFace(ptr unsafe.Pointer) interface{}
+	// PackValue boxes the value stored at ptr into an interface{} whose
+	// dynamic type is T itself, not *T. ptr must point at a live T, e.g.
+	// one obtained from UnsafeNew.
+	PackValue(ptr unsafe.Pointer) interface{}
+	// Indirect unwraps obj (an interface{} holding a *T, as produced by
+	// reflect.New(T).Interface()) and returns the pointer to T.
+	Indirect(obj interface{}) unsafe.Pointer
+	// IsNil reports whether the value at ptr is nil. Only meaningful for
+	// nilable kinds (pointer, map, slice, chan, func, interface).
+	IsNil(ptr unsafe.Pointer) bool
+	// Set copies the value at src into dst.
+	Set(dst, src unsafe.Pointer)
+}
+
+// unsafeType is the base implementation shared by every Type, including
+// the more specific Ptr/Map/Slice/Struct/Interface variants below.
+type unsafeType struct {
+	rtype      reflect.Type
+	ptrRType   unsafe.Pointer
+	valueRType unsafe.Pointer
+}
+
+// TypeOf wraps typ for unsafe access, returning the specialized PtrType,
+// MapType, SliceType, StructType or InterfaceType when typ's kind calls
+// for the extra operations those provide.
+func TypeOf(typ reflect.Type) Type {
+	ptrRType, _ := UnpackEFace(reflect.Zero(reflect.PtrTo(typ)).Interface())
+	valueRType, _ := UnpackEFace(reflect.Zero(typ).Interface())
+	base := unsafeType{rtype: typ, ptrRType: ptrRType, valueRType: valueRType}
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return &UnsafePtrType{base}
+	case reflect.Map:
+		return &UnsafeMapType{base}
+	case reflect.Slice:
+		return &UnsafeSliceType{base}
+	case reflect.Struct:
+		return &UnsafeStructType{base}
+	case reflect.Interface:
+		return &UnsafeInterfaceType{base}
+	default:
+		return &base
+	}
+}
+
+func (t *unsafeType) Type1() reflect.Type { return t.rtype }
+
+func (t *unsafeType) UnsafeNew() unsafe.Pointer {
+	_, word := UnpackEFace(reflect.New(t.rtype).Interface())
+	return word
+}
+
+func (t *unsafeType) PackEFace(ptr unsafe.Pointer) interface{} {
+	return PackEFace(t.ptrRType, ptr)
+}
+
+func (t *unsafeType) PackValue(ptr unsafe.Pointer) interface{} {
+	return reflect.NewAt(t.rtype, ptr).Elem().Interface()
+}
+
+func (t *unsafeType) Indirect(obj interface{}) unsafe.Pointer {
+	_, word := UnpackEFace(obj)
+	return word
+}
+
+func (t *unsafeType) IsNil(ptr unsafe.Pointer) bool {
+	if ptr == nil {
+		return true
+	}
+	return *(*unsafe.Pointer)(ptr) == nil
+}
+
+func (t *unsafeType) Set(dst, src unsafe.Pointer) {
+	reflect.NewAt(t.rtype, dst).Elem().Set(reflect.NewAt(t.rtype, src).Elem())
+}
+
+// PtrType adds pointer-specific operations to Type.
+type PtrType interface {
+	Type
+	Elem() Type
+}
+
+// UnsafePtrType is the default PtrType implementation.
+type UnsafePtrType struct {
+	unsafeType
+}
+
+// Elem returns the type pointed to.
+func (t *UnsafePtrType) Elem() Type {
+	return TypeOf(t.rtype.Elem())
+}
+
+// PackValue overrides unsafeType.PackValue: when T is itself a pointer
+// type, ptr is the address of a *T slot (as returned by UnsafeNew or
+// written into by an optionalDecoder), not the pointer value itself.
+// Boxing a pointer-kind value means the eface word must hold that
+// pointer value directly, so it has to be read out of the slot first -
+// boxing the slot's own address would box a pointer to the wrong thing.
+func (t *UnsafePtrType) PackValue(ptr unsafe.Pointer) interface{} {
+	return PackEFace(t.valueRType, *(*unsafe.Pointer)(ptr))
+}
+
+// InterfaceType adds interface-specific operations to Type.
+type InterfaceType interface {
+	Type
+	// IsEmptyInterface reports whether this is interface{} rather than an
+	// interface with methods.
+	IsEmptyInterface() bool
+	// UnsafeIsNil reports whether the data word of the interface value
+	// pointed to by ptr is nil, handling both interface{} and interfaces
+	// with methods; an interface holding a nil pointer, map, chan or func
+	// also reports true.
+	UnsafeIsNil(ptr unsafe.Pointer) bool
+}
+
+// UnsafeInterfaceType is the default InterfaceType implementation.
+type UnsafeInterfaceType struct {
+	unsafeType
+}
+
+func (t *UnsafeInterfaceType) IsEmptyInterface() bool {
+	return t.rtype.NumMethod() == 0
+}
+
+func (t *UnsafeInterfaceType) UnsafeIsNil(ptr unsafe.Pointer) bool {
+	if t.IsEmptyInterface() {
+		return (*eface)(ptr).word == nil
+	}
+	return (*nonEmptyInterface)(ptr).word == nil
+}
+
+// nonEmptyInterface is the runtime representation of an interface value
+// that has methods (i.e. not interface{}).
+// See runtime/iface.go:Itab.
+type nonEmptyInterface struct {
+	itab *struct {
+		ityp   unsafe.Pointer // static interface type
+		typ    unsafe.Pointer // dynamic concrete type
+		link   unsafe.Pointer
+		bad    int32
+		unused int32
+		fun    [100000]unsafe.Pointer // method table, sized just so &fun can be taken
+	}
+	word unsafe.Pointer
+}
@@ -0,0 +1,163 @@
+package reflect2
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type reflect2TestStruct struct {
+	Name string
+	Age  int
+}
+
+// unsafePointerOf returns the address ptr (itself a pointer value) points
+// to, letting tests build unsafe.Pointer args without spelling out casts.
+func unsafePointerOf(ptr interface{}) unsafe.Pointer {
+	_, word := UnpackEFace(ptr)
+	return word
+}
+
+func TestPackEFaceAndPackValueRoundTrip(t *testing.T) {
+	typ := TypeOf(reflect.TypeOf(reflect2TestStruct{}))
+	ptr := typ.UnsafeNew()
+
+	src := reflect2TestStruct{Name: "gopher", Age: 11}
+	typ.Set(ptr, unsafePointerOf(&src))
+
+	asPointer := typ.PackEFace(ptr)
+	got, ok := asPointer.(*reflect2TestStruct)
+	if !ok {
+		t.Fatalf("PackEFace: got dynamic type %T, want *reflect2TestStruct", asPointer)
+	}
+	if *got != src {
+		t.Fatalf("PackEFace: got %+v, want %+v", *got, src)
+	}
+
+	asValue := typ.PackValue(ptr)
+	gotValue, ok := asValue.(reflect2TestStruct)
+	if !ok {
+		t.Fatalf("PackValue: got dynamic type %T, want reflect2TestStruct", asValue)
+	}
+	if gotValue != src {
+		t.Fatalf("PackValue: got %+v, want %+v", gotValue, src)
+	}
+}
+
+func TestUnpackEFaceRoundTrip(t *testing.T) {
+	rtype, word := UnpackEFace(reflect2TestStruct{Name: "x", Age: 1})
+	rebuilt := PackEFace(rtype, word).(reflect2TestStruct)
+	if rebuilt.Name != "x" || rebuilt.Age != 1 {
+		t.Fatalf("got %+v", rebuilt)
+	}
+}
+
+func TestMapTypeRangeAndSetIndex(t *testing.T) {
+	m := map[string]int{}
+	mapType := TypeOf(reflect.TypeOf(m)).(MapType)
+	ptr := mapType.UnsafeNew()
+
+	key, value := "a", 1
+	mapType.UnsafeSetIndex(ptr, unsafePointerOf(&key), unsafePointerOf(&value))
+
+	seen := map[string]int{}
+	mapType.Range(ptr, func(keyPtr, elemPtr unsafe.Pointer) bool {
+		seen[*(*string)(keyPtr)] = *(*int)(elemPtr)
+		return true
+	})
+	if seen["a"] != 1 {
+		t.Fatalf("Range: got %+v, want map[a:1]", seen)
+	}
+}
+
+func TestSliceTypeGrowAndGetIndex(t *testing.T) {
+	s := []int{1, 2, 3}
+	sliceType := TypeOf(reflect.TypeOf(s)).(SliceType)
+	ptr := unsafePointerOf(&s)
+
+	sliceType.UnsafeGrow(ptr, 5)
+	if sliceType.UnsafeLen(ptr) != 5 {
+		t.Fatalf("UnsafeGrow: got len %d, want 5", sliceType.UnsafeLen(ptr))
+	}
+	elemPtr := sliceType.UnsafeGetIndex(ptr, 1)
+	if *(*int)(elemPtr) != 2 {
+		t.Fatalf("UnsafeGetIndex(1): got %d, want 2", *(*int)(elemPtr))
+	}
+}
+
+func TestStructTypeField(t *testing.T) {
+	structType := TypeOf(reflect.TypeOf(reflect2TestStruct{})).(StructType)
+	if structType.NumField() != 2 {
+		t.Fatalf("NumField: got %d, want 2", structType.NumField())
+	}
+	nameField := structType.Field(0)
+	ptr := structType.UnsafeNew()
+	value := "gopher"
+	structType.Field(0).Type.Set(structType.UnsafeFieldPointer(ptr, nameField), unsafePointerOf(&value))
+	obj := structType.PackValue(ptr).(reflect2TestStruct)
+	if obj.Name != "gopher" {
+		t.Fatalf("got Name %q, want %q", obj.Name, "gopher")
+	}
+}
+
+// TestPtrTypePackValueDereferencesSlot reproduces the exact sequence
+// unionDecoder.Decode performs for a pointer-kind concrete type: allocate
+// a *T slot, write a real pointer into it (as an optionalDecoder would
+// after decoding the pointee), then PackValue it. The boxed interface
+// must hold that real pointer, not a pointer to the slot itself.
+func TestPtrTypePackValueDereferencesSlot(t *testing.T) {
+	ptrType := TypeOf(reflect.TypeOf((*reflect2TestStruct)(nil)))
+	slot := ptrType.UnsafeNew()
+
+	real := &reflect2TestStruct{Name: "gopher", Age: 7}
+	*(*unsafe.Pointer)(slot) = unsafePointerOf(real)
+
+	boxed := ptrType.PackValue(slot)
+	got, ok := boxed.(*reflect2TestStruct)
+	if !ok {
+		t.Fatalf("PackValue: got dynamic type %T, want *reflect2TestStruct", boxed)
+	}
+	if got != real {
+		t.Fatalf("PackValue: got pointer %p, want %p (the slot's own address, not its contents, would be %p)", got, real, slot)
+	}
+	if *got != *real {
+		t.Fatalf("PackValue: got %+v, want %+v", *got, *real)
+	}
+}
+
+func TestInterfaceTypeIsEmptyAndIsNil(t *testing.T) {
+	var e interface{}
+	emptyType := TypeOf(reflect.TypeOf(&e).Elem()).(InterfaceType)
+	if !emptyType.IsEmptyInterface() {
+		t.Fatalf("expected interface{} to report IsEmptyInterface")
+	}
+	if !emptyType.UnsafeIsNil(unsafePointerOf(&e)) {
+		t.Fatalf("expected nil interface{} to report UnsafeIsNil")
+	}
+	e = reflect2TestStruct{}
+	if emptyType.UnsafeIsNil(unsafePointerOf(&e)) {
+		t.Fatalf("expected populated interface{} to report !UnsafeIsNil")
+	}
+
+	var s fmt.Stringer
+	nonEmptyType := TypeOf(reflect.TypeOf(&s).Elem()).(InterfaceType)
+	if nonEmptyType.IsEmptyInterface() {
+		t.Fatalf("expected fmt.Stringer to report !IsEmptyInterface")
+	}
+	if !nonEmptyType.UnsafeIsNil(unsafePointerOf(&s)) {
+		t.Fatalf("expected nil fmt.Stringer to report UnsafeIsNil")
+	}
+}
+
+func TestIsNil(t *testing.T) {
+	var m map[string]int
+	mapType := TypeOf(reflect.TypeOf(m))
+	if !mapType.IsNil(unsafePointerOf(&m)) {
+		t.Fatalf("expected nil map to report IsNil")
+	}
+	m = map[string]int{}
+	if mapType.IsNil(unsafePointerOf(&m)) {
+		t.Fatalf("expected non-nil map to report !IsNil")
+	}
+}
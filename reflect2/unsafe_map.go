@@ -0,0 +1,60 @@
+package reflect2
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// MapType adds unsafe map iteration and assignment to Type.
+type MapType interface {
+	Type
+	Key() Type
+	Elem() Type
+	// Range calls fn with a pointer to each key and value currently in
+	// the map pointed to by ptr, stopping early if fn returns false.
+	Range(ptr unsafe.Pointer, fn func(key, elem unsafe.Pointer) bool)
+	// UnsafeSetIndex assigns the value at elemPtr to the key at keyPtr in
+	// the map pointed to by ptr, allocating the map first if it is nil.
+	UnsafeSetIndex(ptr, keyPtr, elemPtr unsafe.Pointer)
+}
+
+// UnsafeMapType is the default MapType implementation.
+type UnsafeMapType struct {
+	unsafeType
+}
+
+func (t *UnsafeMapType) Key() Type  { return TypeOf(t.rtype.Key()) }
+func (t *UnsafeMapType) Elem() Type { return TypeOf(t.rtype.Elem()) }
+
+func (t *UnsafeMapType) Range(ptr unsafe.Pointer, fn func(key, elem unsafe.Pointer) bool) {
+	m := reflect.NewAt(t.rtype, ptr).Elem()
+	if m.IsNil() {
+		return
+	}
+	// key/elem are allocated once and overwritten in place every
+	// iteration via Set, so Range costs two allocations total rather than
+	// two per entry; fn must be done with keyWord/elemWord before the
+	// next iteration overwrites them.
+	key := reflect.New(t.rtype.Key()).Elem()
+	elem := reflect.New(t.rtype.Elem()).Elem()
+	_, keyWord := UnpackEFace(key.Addr().Interface())
+	_, elemWord := UnpackEFace(elem.Addr().Interface())
+	iter := m.MapRange()
+	for iter.Next() {
+		key.SetIterKey(iter)
+		elem.SetIterValue(iter)
+		if !fn(keyWord, elemWord) {
+			return
+		}
+	}
+}
+
+func (t *UnsafeMapType) UnsafeSetIndex(ptr, keyPtr, elemPtr unsafe.Pointer) {
+	m := reflect.NewAt(t.rtype, ptr).Elem()
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(t.rtype))
+	}
+	key := reflect.NewAt(t.rtype.Key(), keyPtr).Elem()
+	elem := reflect.NewAt(t.rtype.Elem(), elemPtr).Elem()
+	m.SetMapIndex(key, elem)
+}
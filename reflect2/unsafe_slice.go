@@ -0,0 +1,47 @@
+package reflect2
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// SliceType adds unsafe element access and growth to Type.
+type SliceType interface {
+	Type
+	Elem() Type
+	UnsafeLen(ptr unsafe.Pointer) int
+	// UnsafeGetIndex returns a pointer to the element at idx in the slice
+	// pointed to by ptr.
+	UnsafeGetIndex(ptr unsafe.Pointer, idx int) unsafe.Pointer
+	// UnsafeGrow resizes the slice pointed to by ptr to newLen, growing
+	// the backing array if needed.
+	UnsafeGrow(ptr unsafe.Pointer, newLen int)
+}
+
+// UnsafeSliceType is the default SliceType implementation.
+type UnsafeSliceType struct {
+	unsafeType
+}
+
+func (t *UnsafeSliceType) Elem() Type { return TypeOf(t.rtype.Elem()) }
+
+func (t *UnsafeSliceType) UnsafeLen(ptr unsafe.Pointer) int {
+	return reflect.NewAt(t.rtype, ptr).Elem().Len()
+}
+
+func (t *UnsafeSliceType) UnsafeGetIndex(ptr unsafe.Pointer, idx int) unsafe.Pointer {
+	elem := reflect.NewAt(t.rtype, ptr).Elem().Index(idx)
+	_, word := UnpackEFace(elem.Addr().Interface())
+	return word
+}
+
+func (t *UnsafeSliceType) UnsafeGrow(ptr unsafe.Pointer, newLen int) {
+	slice := reflect.NewAt(t.rtype, ptr).Elem()
+	if newLen <= slice.Cap() {
+		slice.SetLen(newLen)
+		return
+	}
+	grown := reflect.MakeSlice(t.rtype, newLen, newLen+newLen/2+1)
+	reflect.Copy(grown, slice)
+	slice.Set(grown)
+}
@@ -0,0 +1,41 @@
+package reflect2
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// StructType adds unsafe field access to Type.
+type StructType interface {
+	Type
+	NumField() int
+	Field(i int) StructField
+	// UnsafeFieldPointer returns a pointer to field within a struct
+	// pointed to by ptr.
+	UnsafeFieldPointer(ptr unsafe.Pointer, field StructField) unsafe.Pointer
+}
+
+// StructField describes one field of a StructType, carrying enough of
+// reflect.StructField for codecs plus the unsafe offset needed to
+// address it directly.
+type StructField struct {
+	reflect.StructField
+	Type   Type
+	offset uintptr
+}
+
+// UnsafeStructType is the default StructType implementation.
+type UnsafeStructType struct {
+	unsafeType
+}
+
+func (t *UnsafeStructType) NumField() int { return t.rtype.NumField() }
+
+func (t *UnsafeStructType) Field(i int) StructField {
+	f := t.rtype.Field(i)
+	return StructField{StructField: f, Type: TypeOf(f.Type), offset: f.Offset}
+}
+
+func (t *UnsafeStructType) UnsafeFieldPointer(ptr unsafe.Pointer, field StructField) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(ptr) + field.offset)
+}